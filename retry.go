@@ -0,0 +1,38 @@
+package soapclient
+
+import (
+	"context"
+	"time"
+)
+
+/*
+DoContext behaves like Do, but takes a context.Context so callers can cancel an
+in-flight SOAP call or bound it with a deadline; the underlying HTTP request is
+built with http.NewRequestWithContext.
+*/
+func (s *SOAPClient) DoContext(ctx context.Context, soapAction string, request, response interface{}) error {
+	buffer, err := s.encodeEnvelope(nil, request)
+	if err != nil {
+		return err
+	}
+
+	return s.doRawRequestCtx(ctx, soapAction, buffer.Bytes(), response, nil, nil)
+}
+
+/*
+WithRetry enables retrying a call's HTTP request up to maxAttempts times (1 means
+no retry). Between attempts, backoff(attempt) is awaited (attempt starts at 1 for
+the first retry) before resending the already-buffered request body; a backoff
+that adds jitter is the caller's responsibility. retryOn is consulted after each
+failed attempt that still has attempts left (and was not ended by ctx being
+canceled or expiring), with the HTTP status reached (0 if the request never got a
+response) and the *SOAPFault, if any, and should report whether that failure is
+worth retrying (e.g. a 503 or a throttling fault code). It returns the same
+SOAPClient for chaining.
+*/
+func (s *SOAPClient) WithRetry(maxAttempts int, backoff func(attempt int) time.Duration, retryOn func(status int, fault *SOAPFault) bool) *SOAPClient {
+	s.retryMaxAttempts = maxAttempts
+	s.retryBackoff = backoff
+	s.retryOn = retryOn
+	return s
+}
@@ -0,0 +1,78 @@
+package soapclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestDoContextRetriesOnServerError is a regression test for a bug where the
+// retry loop never looked at the HTTP status code: attemptRequest returned a nil
+// error whenever the response body decoded cleanly and carried no <Fault>, even
+// on a 503, so WithRetry's retryOn was never even consulted and a transient
+// outage was silently treated as success. A well-formed, fault-free envelope
+// over a non-2xx status must still be retried.
+func TestDoContextRetriesOnServerError(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`<?xml version="1.0"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body></soap:Body></soap:Envelope>`))
+			return
+		}
+		w.Write([]byte(`<?xml version="1.0"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><Ok><Value>done</Value></Ok></soap:Body></soap:Envelope>`))
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL).WithRetry(3, func(int) time.Duration { return time.Millisecond }, func(status int, fault *SOAPFault) bool {
+		return status == http.StatusServiceUnavailable
+	})
+
+	var resp struct {
+		Value string `xml:"Value"`
+	}
+	err := client.DoContext(context.Background(), "urn:test/Echo", &struct{}{}, &resp)
+	if err != nil {
+		t.Fatalf("DoContext: %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("attempts = %d, want 3 (first two 503s must be retried)", attempts)
+	}
+	if resp.Value != "done" {
+		t.Fatalf("resp.Value = %q, want %q", resp.Value, "done")
+	}
+}
+
+// TestDoContextGivesUpWhenRetryOnDeclines checks that a non-2xx status is still
+// surfaced as an error when retryOn says not to retry it (or no retry policy is
+// configured at all), rather than always retrying every non-2xx response.
+func TestDoContextGivesUpWhenRetryOnDeclines(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`<?xml version="1.0"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body></soap:Body></soap:Envelope>`))
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL)
+	var resp struct{}
+	err := client.DoContext(context.Background(), "urn:test/Echo", &struct{}{}, &resp)
+	if err == nil {
+		t.Fatal("DoContext: want error for a 500 status, got nil")
+	}
+
+	attempts = 0
+	declining := New(srv.URL).WithRetry(3, func(int) time.Duration { return time.Millisecond }, func(status int, fault *SOAPFault) bool {
+		return false
+	})
+	if err := declining.DoContext(context.Background(), "urn:test/Echo", &struct{}{}, &resp); err == nil {
+		t.Fatal("DoContext with declining retryOn: want error for a 500 status, got nil")
+	}
+	if attempts != 1 {
+		t.Fatalf("attempts = %d, want 1 (retryOn declined the retry)", attempts)
+	}
+}
@@ -0,0 +1,66 @@
+package soapclient
+
+import "encoding/xml"
+
+const (
+	soap11NS = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12NS = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+/*SOAPVersion selects the envelope namespace and transport framing a SOAPClient uses.*/
+type SOAPVersion int
+
+const (
+	/*SOAP11 is the default: the http://schemas.xmlsoap.org/soap/envelope/ namespace,
+	a "text/xml" Content-Type and the SOAP action carried in a separate SOAPAction header.*/
+	SOAP11 SOAPVersion = iota
+	/*SOAP12 switches to the http://www.w3.org/2003/05/soap-envelope namespace, an
+	"application/soap+xml" Content-Type carrying the action itself. Responses (and
+	their SOAP 1.1 or SOAP 1.2 fault shape) are decoded by the envelope namespace
+	found on the wire, whichever version is set.*/
+	SOAP12
+)
+
+/*
+WithVersion sets the SOAP version a SOAPClient speaks and returns the same
+SOAPClient for chaining. The zero value is SOAP11.
+*/
+func (s *SOAPClient) WithVersion(v SOAPVersion) *SOAPClient {
+	s.version = v
+	return s
+}
+
+// envelopeNS returns the SOAP envelope namespace s is configured for, for code
+// (such as DoSigned) that builds an envelope by hand instead of through
+// encodeEnvelope's SOAPEnvelope/soap12Envelope types.
+func (s *SOAPClient) envelopeNS() string {
+	if s.version == SOAP12 {
+		return soap12NS
+	}
+	return soap11NS
+}
+
+// soap12Envelope, soap12Header and soap12Body mirror SOAPEnvelope/SOAPHeader/SOAPBody
+// under the SOAP 1.2 namespace. SOAPFault is shared between versions: its XMLName
+// tag carries no namespace, so it matches a Fault element under either body.
+type soap12Envelope struct {
+	XMLName  xml.Name `xml:"http://www.w3.org/2003/05/soap-envelope Envelope"`
+	XSIXmlns string   `xml:"xmlns:xsi,attr"`
+
+	Header *soap12Header
+	Body   soap12Body
+}
+
+type soap12Header struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2003/05/soap-envelope Header"`
+	Header  interface{}
+	Headers []interface{} `xml:",any"`
+	Raw     []byte        `xml:",innerxml"`
+}
+
+type soap12Body struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2003/05/soap-envelope Body"`
+
+	Fault   *SOAPFault  `xml:",omitempty"`
+	Content interface{} `xml:",any"`
+}
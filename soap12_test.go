@@ -0,0 +1,70 @@
+package soapclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestDoSOAP12FaultRoundTrip checks that a SOAP 1.2 fault (Code/Value, Code/
+// Subcode/Value, Reason/Text) sent over the wire is decoded into SOAPFault the
+// same way a SOAP 1.1 faultcode/faultstring fault is. This commit's envelope/
+// fault handling had no coverage at all until now.
+func TestDoSOAP12FaultRoundTrip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope">
+  <soap:Body>
+    <soap:Fault>
+      <soap:Code>
+        <soap:Value>soap:Sender</soap:Value>
+        <soap:Subcode><soap:Value>rpc:BadArguments</soap:Value></soap:Subcode>
+      </soap:Code>
+      <soap:Reason><soap:Text>Invalid request</soap:Text></soap:Reason>
+    </soap:Fault>
+  </soap:Body>
+</soap:Envelope>`))
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL).WithVersion(SOAP12)
+	var resp struct{}
+	err := client.Do("urn:test/Echo", &struct{}{}, &resp)
+
+	var fault *SOAPFault
+	if !errors.As(err, &fault) {
+		t.Fatalf("Do: want *SOAPFault, got %v", err)
+	}
+	if want := "soap:Sender/rpc:BadArguments"; fault.Code != want {
+		t.Fatalf("fault.Code = %q, want %q", fault.Code, want)
+	}
+	if want := "Invalid request"; fault.String != want {
+		t.Fatalf("fault.String = %q, want %q", fault.String, want)
+	}
+}
+
+// TestDoSOAP12NamespaceAutoDetection checks that a response is decoded
+// correctly even when its envelope namespace doesn't match the client's
+// configured version (detectEnvelopeNamespace picks the response shape from
+// the wire rather than trusting s.version).
+func TestDoSOAP12NamespaceAutoDetection(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope">
+  <soap:Body><Ok><Value>done</Value></Ok></soap:Body>
+</soap:Envelope>`))
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL)
+	var resp struct {
+		Value string `xml:"Value"`
+	}
+	if err := client.Do("urn:test/Echo", &struct{}{}, &resp); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if resp.Value != "done" {
+		t.Fatalf("resp.Value = %q, want %q", resp.Value, "done")
+	}
+}
@@ -3,15 +3,23 @@ package soapclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"reflect"
+	"strings"
+	"time"
 )
 
-/*SOAPEnvelope represents a SOAP envelope.
+/*
+SOAPEnvelope represents a SOAP envelope.
 
-Aside from it, it Also allows for setting a XSI (XMLSchema-instance) namespace if the XSIXmlns field is set to it.*/
+Aside from it, it Also allows for setting a XSI (XMLSchema-instance) namespace if the XSIXmlns field is set to it.
+*/
 type SOAPEnvelope struct {
 	XMLName  xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
 	XSIXmlns string   `xml:"xmlns:xsi,attr"`
@@ -20,15 +28,27 @@ type SOAPEnvelope struct {
 	Body   SOAPBody
 }
 
-/*SOAPHeader represents a SOAP header.*/
+/*
+SOAPHeader represents a SOAP header.
+
+Header holds a single outgoing header element; nothing in this package sets it
+(DoSigned builds its own Header element).
+Headers holds the outgoing header elements passed to DoWithHeaders. Raw captures
+the still-encoded content of an incoming header, which DoWithHeaders decodes into
+any matching pointer supplied via its responseHeaders parameter.
+*/
 type SOAPHeader struct {
 	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Header"`
 	Header  interface{}
+	Headers []interface{} `xml:",any"`
+	Raw     []byte        `xml:",innerxml"`
 }
 
-/*SOAPBody represents a SOAP body.
+/*
+SOAPBody represents a SOAP body.
 
-When unmarshaled into, it carries either a "Fault" (if the SOAP response is faulted) or a "Content" with the SOAP response's body.*/
+When unmarshaled into, it carries either a "Fault" (if the SOAP response is faulted) or a "Content" with the SOAP response's body.
+*/
 type SOAPBody struct {
 	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
 
@@ -36,24 +56,125 @@ type SOAPBody struct {
 	Content interface{} `xml:",any"`
 }
 
-/*SOAPFault represents a SOAP fault.*/
+/*
+SOAPFault represents a SOAP fault, normalized from either a SOAP 1.1
+(faultcode/faultstring/faultactor) or a SOAP 1.2 (Code/Reason/Role) fault. It
+implements error, so it can be returned directly from Do/DoWithHeaders and
+recovered by callers via errors.As.
+
+XMLName carries no namespace so that it matches a Fault element regardless of
+which SOAP version's Body it was found under; UnmarshalXML inspects the element's
+children to tell the two shapes apart.
+*/
 type SOAPFault struct {
-	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Fault"`
+	XMLName xml.Name `xml:"Fault"`
+
+	Code   string      `xml:"faultcode,omitempty"`
+	String string      `xml:"faultstring,omitempty"`
+	Actor  string      `xml:"faultactor,omitempty"`
+	Detail FaultDetail `xml:"detail,omitempty"`
+}
+
+func (f *SOAPFault) Error() string {
+	return fmt.Sprintf("soapclient: received SOAP fault with code %q: %s", f.Code, f.String)
+}
+
+// soap11FaultShape and soap12FaultShape are the two wire shapes SOAPFault.UnmarshalXML
+// tries in turn; whichever one actually has a code wins.
+type soap11FaultShape struct {
+	Code   string      `xml:"faultcode"`
+	String string      `xml:"faultstring"`
+	Actor  string      `xml:"faultactor"`
+	Detail FaultDetail `xml:"detail"`
+}
+
+type soap12FaultShape struct {
+	Code struct {
+		Value   string `xml:"Value"`
+		Subcode struct {
+			Value string `xml:"Value"`
+		} `xml:"Subcode"`
+	} `xml:"Code"`
+	Reason struct {
+		Text []string `xml:"Text"`
+	} `xml:"Reason"`
+	Role   string      `xml:"Role"`
+	Detail FaultDetail `xml:"Detail"`
+}
+
+/*
+UnmarshalXML lets SOAPFault decode both the SOAP 1.1 and SOAP 1.2 fault shapes
+into the same set of fields.
+*/
+func (f *SOAPFault) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var raw struct {
+		Inner []byte `xml:",innerxml"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+	f.XMLName = start.Name
+
+	wrapped := append(append([]byte("<fault>"), raw.Inner...), []byte("</fault>")...)
+
+	var v12 soap12FaultShape
+	if err := xml.Unmarshal(wrapped, &v12); err == nil && v12.Code.Value != "" {
+		f.Code = v12.Code.Value
+		if v12.Code.Subcode.Value != "" {
+			f.Code += "/" + v12.Code.Subcode.Value
+		}
+		if len(v12.Reason.Text) > 0 {
+			f.String = v12.Reason.Text[0]
+		}
+		f.Actor = v12.Role
+		f.Detail = v12.Detail
+		return nil
+	}
 
-	Code   string `xml:"faultcode,omitempty"`
-	String string `xml:"faultstring,omitempty"`
-	Actor  string `xml:"faultactor,omitempty"`
-	Detail string `xml:"detail,omitempty"`
+	var v11 soap11FaultShape
+	if err := xml.Unmarshal(wrapped, &v11); err != nil {
+		return err
+	}
+	f.Code = v11.Code
+	f.String = v11.String
+	f.Actor = v11.Actor
+	f.Detail = v11.Detail
+	return nil
+}
+
+/*
+FaultDetail carries a SOAP fault's <detail> contents. Raw is the still-encoded
+element content; Content is populated with whatever pointer the caller passed as
+DoWithHeaders' faultDetail argument, once it has been successfully unmarshalled
+from Raw.
+*/
+type FaultDetail struct {
+	Raw     []byte      `xml:",innerxml"`
+	Content interface{} `xml:"-"`
 }
 
 /*A SOAPClient can perform SOAP requests to an endpoint.*/
 type SOAPClient struct {
 	endpoint string
+	version  SOAPVersion
+
+	httpClient   *http.Client
+	preSend      func(*http.Request) error
+	postResponse func(*http.Response, []byte) error
+
+	requireXSI bool
+
+	retryMaxAttempts int
+	retryBackoff     func(attempt int) time.Duration
+	retryOn          func(status int, fault *SOAPFault) bool
 }
 
-/*Initialize a SOAPClient with a SOAP endpoint.*/
+/*
+Initialize a SOAPClient with a SOAP endpoint. It defaults to SOAP11; use
+WithVersion to speak SOAP12 instead.
+*/
 func New(endpoint string) *SOAPClient {
-	return &SOAPClient{endpoint}
+	return &SOAPClient{endpoint: endpoint}
 }
 
 /*
@@ -65,70 +186,292 @@ The function will:
 3. will unmarshal the SOAP response's SOAP body to "response", which should an empty pointer to a marshalable struct.
 
 This function returns an error on case of XML encoding errors, HTTP errors, an empty SOAP response
-or a SOAP fault.
+or a SOAP fault, in which case the error is a *SOAPFault.
 
-This function does not yet provide support for handling SOAP headers or SOAP faults.
+This function does not send or receive SOAP headers; use DoWithHeaders for that.
 */
 func (s *SOAPClient) Do(soapAction string, request, response interface{}) error {
-	/* TODO: This function is very limited for a SOAP client. We should be
-	able to send/receive headers, expose faults and have TLS options. */
+	buffer, err := s.encodeEnvelope(nil, request)
+	if err != nil {
+		return err
+	}
+
+	return s.doRawRequest(soapAction, buffer, response)
+}
+
+/*
+DoWithHeaders behaves like Do, but additionally lets callers attach outgoing SOAP
+header elements and recover structured data the basic Do discards:
 
-	envelope := SOAPEnvelope{
-		XSIXmlns: "http://www.w3.org/2001/XMLSchema-instance",
-		Header:   nil,
+  - headers are marshalled as-is into the request's <soap:Header>.
+  - responseHeaders, if non-nil, is a slice of pointers; any header element the
+    server returns whose XMLName matches a pointer's declared XMLName is decoded
+    into it.
+  - faultDetail, if non-nil, is a pointer that a SOAP fault's <detail> content (if
+    any) is decoded into; on success it is also attached to the returned
+    *SOAPFault's Detail.Content.
+*/
+func (s *SOAPClient) DoWithHeaders(soapAction string, headers []interface{}, request, response interface{}, responseHeaders []interface{}, faultDetail interface{}) error {
+	buffer, err := s.encodeEnvelope(headers, request)
+	if err != nil {
+		return err
 	}
-	envelope.Body.Content = request
 
+	return s.doRawRequestWithHeaders(soapAction, buffer, response, responseHeaders, faultDetail)
+}
+
+// encodeEnvelope marshals request (and, if any, headers) into an envelope using
+// whichever SOAP version s is configured for.
+func (s *SOAPClient) encodeEnvelope(headers []interface{}, request interface{}) (*bytes.Buffer, error) {
 	buffer := new(bytes.Buffer)
 	encoder := xml.NewEncoder(buffer)
 
-	if err := encoder.Encode(envelope); err != nil {
-		return err
+	content := request
+	if s.requireXSI || hasXSITags(reflect.ValueOf(request)) {
+		content = xsiElementForRequest(request, s.requireXSI)
 	}
 
+	var err error
+	if s.version == SOAP12 {
+		envelope := soap12Envelope{XSIXmlns: "http://www.w3.org/2001/XMLSchema-instance"}
+		if len(headers) > 0 {
+			envelope.Header = &soap12Header{Headers: headers}
+		}
+		envelope.Body.Content = content
+		err = encoder.Encode(envelope)
+	} else {
+		envelope := SOAPEnvelope{XSIXmlns: "http://www.w3.org/2001/XMLSchema-instance"}
+		if len(headers) > 0 {
+			envelope.Header = &SOAPHeader{Headers: headers}
+		}
+		envelope.Body.Content = content
+		err = encoder.Encode(envelope)
+	}
+	if err != nil {
+		return nil, err
+	}
 	if err := encoder.Flush(); err != nil {
-		return err
+		return nil, err
+	}
+	return buffer, nil
+}
+
+// doRawRequest POSTs an already-encoded SOAP envelope to the endpoint and decodes
+// the response body into "response", returning an error on a SOAP fault.
+func (s *SOAPClient) doRawRequest(soapAction string, buffer *bytes.Buffer, response interface{}) error {
+	return s.doRawRequestWithHeaders(soapAction, buffer, response, nil, nil)
+}
+
+func (s *SOAPClient) doRawRequestWithHeaders(soapAction string, buffer *bytes.Buffer, response interface{}, responseHeaders []interface{}, faultDetail interface{}) error {
+	return s.doRawRequestCtx(context.Background(), soapAction, buffer.Bytes(), response, responseHeaders, faultDetail)
+}
+
+// doRawRequestCtx sends the already-encoded envelope body, retrying according to
+// s's retry policy (if any) on top of the single attempt attemptRequest makes.
+func (s *SOAPClient) doRawRequestCtx(ctx context.Context, soapAction string, body []byte, response interface{}, responseHeaders []interface{}, faultDetail interface{}) error {
+	attempts := s.retryMaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		status, err := s.attemptRequest(ctx, soapAction, body, response, responseHeaders, faultDetail)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return err
+		}
+		if attempt == attempts || s.retryOn == nil {
+			break
+		}
+
+		var fault *SOAPFault
+		errors.As(err, &fault)
+		if !s.retryOn(status, fault) {
+			break
+		}
+
+		if s.retryBackoff != nil {
+			select {
+			case <-time.After(s.retryBackoff(attempt)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
 	}
+	return lastErr
+}
 
-	req, err := http.NewRequest("POST", s.endpoint, buffer)
+// attemptRequest performs a single POST of body to the endpoint and decodes the
+// response, returning the HTTP status code reached (0 if the request never got a
+// response) alongside any error, so the retry loop can consult both.
+func (s *SOAPClient) attemptRequest(ctx context.Context, soapAction string, body []byte, response interface{}, responseHeaders []interface{}, faultDetail interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.endpoint, bytes.NewReader(body))
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	req.Header.Add("Content-Type", "text/xml; charset=\"utf-8\"")
-	req.Header.Add("SOAPAction", soapAction)
-	req.Close = true
+	if s.version == SOAP12 {
+		req.Header.Set("Content-Type", fmt.Sprintf(`application/soap+xml; charset=utf-8; action="%s"`, soapAction))
+	} else {
+		req.Header.Add("Content-Type", "text/xml; charset=\"utf-8\"")
+		req.Header.Add("SOAPAction", soapAction)
+	}
+	if s.preSend != nil {
+		if err := s.preSend(req); err != nil {
+			return 0, err
+		}
+	}
 
-	client := &http.Client{}
+	client := s.httpClient
+	if client == nil {
+		client = &http.Client{}
+	}
 	res, err := client.Do(req)
 
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer res.Body.Close()
 
 	rawbody, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return err
+		return res.StatusCode, err
 	}
+
+	if s.postResponse != nil {
+		if err := s.postResponse(res, rawbody); err != nil {
+			return res.StatusCode, err
+		}
+	}
+
 	if len(rawbody) == 0 {
-		return fmt.Errorf("received empty raw body")
+		return res.StatusCode, fmt.Errorf("received empty raw body")
 	}
 
-	respEnvelope := new(SOAPEnvelope)
-	respEnvelope.Body = SOAPBody{Content: response}
+	var (
+		headerRaw []byte
+		fault     *SOAPFault
+	)
 
-	err = xml.Unmarshal(rawbody, respEnvelope)
+	if detectEnvelopeNamespace(rawbody) == soap12NS {
+		respEnvelope := new(soap12Envelope)
+		respEnvelope.Header = &soap12Header{}
+		respEnvelope.Body = soap12Body{Content: response}
 
-	if err != nil {
-		return err
+		if err := xml.Unmarshal(rawbody, respEnvelope); err != nil {
+			return res.StatusCode, err
+		}
+		headerRaw = respEnvelope.Header.Raw
+		fault = respEnvelope.Body.Fault
+	} else {
+		respEnvelope := new(SOAPEnvelope)
+		respEnvelope.Header = &SOAPHeader{}
+		respEnvelope.Body = SOAPBody{Content: response}
+
+		if err := xml.Unmarshal(rawbody, respEnvelope); err != nil {
+			return res.StatusCode, err
+		}
+		headerRaw = respEnvelope.Header.Raw
+		fault = respEnvelope.Body.Fault
 	}
 
-	fault := respEnvelope.Body.Fault
+	if len(responseHeaders) > 0 && len(headerRaw) > 0 {
+		if err := populateHeaders(headerRaw, responseHeaders); err != nil {
+			return res.StatusCode, err
+		}
+	}
 
 	if fault != nil {
-		return fmt.Errorf("received SOAP fault with code " + fault.Code)
+		if faultDetail != nil && len(fault.Detail.Raw) > 0 {
+			if err := xml.Unmarshal(fault.Detail.Raw, faultDetail); err == nil {
+				fault.Detail.Content = faultDetail
+			}
+		}
+		return res.StatusCode, fault
 	}
 
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, fmt.Errorf("soapclient: unexpected HTTP status %d", res.StatusCode)
+	}
+
+	return res.StatusCode, nil
+}
+
+// detectEnvelopeNamespace peeks at the root element of a SOAP response to tell
+// whether it's a SOAP 1.1 or a SOAP 1.2 envelope, regardless of which version
+// the client is configured for (servers in mixed environments don't always agree).
+func detectEnvelopeNamespace(raw []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Space
+		}
+	}
+}
+
+// populateHeaders scans the raw, still-encoded content of an incoming SOAP header
+// and decodes each child element into whichever pointer in targets declares a
+// matching XMLName, skipping elements with no match.
+func populateHeaders(raw []byte, targets []interface{}) error {
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		for _, target := range targets {
+			if headerNameMatches(target, start.Name) {
+				if err := decoder.DecodeElement(target, &start); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
 	return nil
 }
+
+func headerNameMatches(target interface{}, name xml.Name) bool {
+	t := reflect.TypeOf(target)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return false
+	}
+
+	field, ok := t.FieldByName("XMLName")
+	if !ok {
+		return false
+	}
+
+	tag := strings.Fields(field.Tag.Get("xml"))
+	if len(tag) == 0 {
+		return false
+	}
+
+	want := xml.Name{Local: tag[len(tag)-1]}
+	if len(tag) > 1 {
+		want.Space = tag[0]
+	}
+
+	return want == name
+}
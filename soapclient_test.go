@@ -0,0 +1,79 @@
+package soapclient
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestHeaderNameMatchesComparesNamespace is a regression test for a bug where
+// headerNameMatches only ever compared name.Local, so two response header
+// elements sharing a local name but living in different namespaces (e.g. a
+// custom Id alongside a WS-Addressing Id) would match the wrong
+// responseHeaders target, or whichever was declared first would win
+// arbitrarily.
+func TestHeaderNameMatchesComparesNamespace(t *testing.T) {
+	type CustomID struct {
+		XMLName xml.Name `xml:"urn:custom Id"`
+	}
+	type AddressingID struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/08/addressing Id"`
+	}
+
+	custom := CustomID{}
+	addressing := AddressingID{}
+
+	if !headerNameMatches(&custom, xml.Name{Space: "urn:custom", Local: "Id"}) {
+		t.Fatal("custom target should match its own namespace")
+	}
+	if headerNameMatches(&custom, xml.Name{Space: "http://www.w3.org/2005/08/addressing", Local: "Id"}) {
+		t.Fatal("custom target must not match a differently namespaced Id element")
+	}
+	if !headerNameMatches(&addressing, xml.Name{Space: "http://www.w3.org/2005/08/addressing", Local: "Id"}) {
+		t.Fatal("addressing target should match its own namespace")
+	}
+}
+
+// TestDoWithHeadersRoutesHeaderByNamespace exercises populateHeaders end to end:
+// two response header targets share the local name "Id" but declare different
+// namespaces, and only the one whose namespace matches the server's actual
+// response element should be populated.
+func TestDoWithHeadersRoutesHeaderByNamespace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Header><Id xmlns="http://www.w3.org/2005/08/addressing">addr-1</Id></soap:Header>
+  <soap:Body><Ok><Value>done</Value></Ok></soap:Body>
+</soap:Envelope>`))
+	}))
+	defer srv.Close()
+
+	type CustomID struct {
+		XMLName xml.Name `xml:"urn:custom Id"`
+		Value   string   `xml:",chardata"`
+	}
+	type AddressingID struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/08/addressing Id"`
+		Value   string   `xml:",chardata"`
+	}
+
+	custom := &CustomID{}
+	addressing := &AddressingID{}
+
+	var resp struct {
+		Value string `xml:"Value"`
+	}
+	client := New(srv.URL)
+	err := client.DoWithHeaders("urn:test/Echo", nil, &struct{}{}, &resp, []interface{}{custom, addressing}, nil)
+	if err != nil {
+		t.Fatalf("DoWithHeaders: %v", err)
+	}
+
+	if custom.Value != "" {
+		t.Fatalf("custom.Value = %q, want empty (response Id is addressing-namespaced, not urn:custom)", custom.Value)
+	}
+	if addressing.Value != "addr-1" {
+		t.Fatalf("addressing.Value = %q, want %q", addressing.Value, "addr-1")
+	}
+}
@@ -0,0 +1,35 @@
+package soapclient
+
+import "net/http"
+
+/*
+WithHTTPClient lets callers supply their own *http.Client (for custom TLS
+configuration, timeouts, proxies or transports) instead of the zero-value
+http.Client SOAPClient uses by default. It returns the same SOAPClient for
+chaining.
+*/
+func (s *SOAPClient) WithHTTPClient(client *http.Client) *SOAPClient {
+	s.httpClient = client
+	return s
+}
+
+/*
+WithPreSendHook sets a callback that runs on the outgoing *http.Request after the
+envelope has been marshalled into its body but before it is sent, so callers can
+attach Basic/Bearer auth, add extra headers, log the outgoing XML, or otherwise
+mutate the request. Returning an error aborts the call before it is sent.
+*/
+func (s *SOAPClient) WithPreSendHook(hook func(*http.Request) error) *SOAPClient {
+	s.preSend = hook
+	return s
+}
+
+/*
+WithPostResponseHook sets a callback that runs on the raw *http.Response and its
+already-read body as soon as they're available, before fault parsing, so callers
+can log or inspect the response. Returning an error aborts the call with that error.
+*/
+func (s *SOAPClient) WithPostResponseHook(hook func(*http.Response, []byte) error) *SOAPClient {
+	s.postResponse = hook
+	return s
+}
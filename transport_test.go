@@ -0,0 +1,111 @@
+package soapclient
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestWithPreSendHookMutatesRequest checks that a pre-send hook can attach a
+// header before the request goes out, and that returning an error from it
+// aborts the call before anything is sent.
+func TestWithPreSendHookMutatesRequest(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`<?xml version="1.0"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><Ok><Value>done</Value></Ok></soap:Body></soap:Envelope>`))
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL).WithPreSendHook(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer token")
+		return nil
+	})
+	var resp struct {
+		Value string `xml:"Value"`
+	}
+	if err := client.Do("urn:test/Echo", &struct{}{}, &resp); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if gotAuth != "Bearer token" {
+		t.Fatalf("Authorization header = %q, want %q", gotAuth, "Bearer token")
+	}
+
+	hookErr := errors.New("boom")
+	var sent bool
+	srv2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = true
+	}))
+	defer srv2.Close()
+
+	abortClient := New(srv2.URL).WithPreSendHook(func(req *http.Request) error { return hookErr })
+	err := abortClient.Do("urn:test/Echo", &struct{}{}, &resp)
+	if !errors.Is(err, hookErr) {
+		t.Fatalf("Do: want %v, got %v", hookErr, err)
+	}
+	if sent {
+		t.Fatal("request reached the server despite the pre-send hook returning an error")
+	}
+}
+
+// TestWithPostResponseHookSeesRawBody checks that the post-response hook
+// receives the raw response body before fault parsing, and that an error from
+// it aborts the call.
+func TestWithPostResponseHookSeesRawBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><Ok><Value>done</Value></Ok></soap:Body></soap:Envelope>`))
+	}))
+	defer srv.Close()
+
+	var gotBody string
+	client := New(srv.URL).WithPostResponseHook(func(res *http.Response, body []byte) error {
+		gotBody = string(body)
+		return nil
+	})
+	var resp struct {
+		Value string `xml:"Value"`
+	}
+	if err := client.Do("urn:test/Echo", &struct{}{}, &resp); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if gotBody == "" {
+		t.Fatal("post-response hook did not see the raw response body")
+	}
+
+	hookErr := errors.New("boom")
+	abortClient := New(srv.URL).WithPostResponseHook(func(res *http.Response, body []byte) error { return hookErr })
+	if err := abortClient.Do("urn:test/Echo", &struct{}{}, &resp); !errors.Is(err, hookErr) {
+		t.Fatalf("Do: want %v, got %v", hookErr, err)
+	}
+}
+
+// TestWithHTTPClientIsUsed checks that a custom *http.Client is actually the
+// one making the request, by wrapping its Transport and observing the call.
+func TestWithHTTPClientIsUsed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><Ok><Value>done</Value></Ok></soap:Body></soap:Envelope>`))
+	}))
+	defer srv.Close()
+
+	var used bool
+	custom := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		used = true
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+
+	client := New(srv.URL).WithHTTPClient(custom)
+	var resp struct {
+		Value string `xml:"Value"`
+	}
+	if err := client.Do("urn:test/Echo", &struct{}{}, &resp); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if !used {
+		t.Fatal("custom http.Client's Transport was never invoked")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -0,0 +1,462 @@
+package soapclient
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	wsseNS   = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	wsuNS    = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+	dsNS     = "http://www.w3.org/2000/09/xmldsig#"
+	c14nAlgo = "http://www.w3.org/2001/10/xml-exc-c14n#"
+
+	bstValueType    = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-x509-token-profile-1.0#X509v3"
+	bstEncodingType = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary"
+	strValueType    = bstValueType
+)
+
+/*
+WSSEAuthInfo holds the X.509 certificate and RSA private key used to sign outgoing
+SOAP envelopes with WS-Security (WSSE), as consumed by SOAPClient.DoSigned.
+*/
+type WSSEAuthInfo struct {
+	cert      *x509.Certificate
+	key       *rsa.PrivateKey
+	certDER   []byte
+	useSHA256 bool
+}
+
+/*
+NewWSSEAuthInfo parses a PEM-encoded X.509 certificate and its matching RSA private
+key (PKCS1 or PKCS8) and returns a WSSEAuthInfo ready to sign envelopes.
+*/
+func NewWSSEAuthInfo(certPEM, keyPEM string) (*WSSEAuthInfo, error) {
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	if certBlock == nil {
+		return nil, fmt.Errorf("wsse: failed to decode certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("wsse: failed to parse certificate: %w", err)
+	}
+
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	if keyBlock == nil {
+		return nil, fmt.Errorf("wsse: failed to decode private key PEM")
+	}
+	key, err := parseRSAPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("wsse: failed to parse private key: %w", err)
+	}
+
+	return &WSSEAuthInfo{cert: cert, key: key, certDER: certBlock.Bytes}, nil
+}
+
+/*
+UseSHA256 switches the digest and signature algorithms from the default RSA-SHA1
+to RSA-SHA256, and returns the same WSSEAuthInfo for chaining.
+*/
+func (a *WSSEAuthInfo) UseSHA256(v bool) *WSSEAuthInfo {
+	a.useSHA256 = v
+	return a
+}
+
+func parseRSAPrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("wsse: private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+/*
+wsseSecurity is the <wsse:Security> header element inserted into the envelope's
+Header when a request is signed via DoSigned.
+*/
+type wsseSecurity struct {
+	XMLName             xml.Name `xml:"wsse:Security"`
+	WsseXmlns           string   `xml:"xmlns:wsse,attr"`
+	WsuXmlns            string   `xml:"xmlns:wsu,attr"`
+	MustUnderstand      string   `xml:"soap:mustUnderstand,attr"`
+	BinarySecurityToken binarySecurityToken
+	Timestamp           wsuTimestamp
+	Signature           signature
+}
+
+type binarySecurityToken struct {
+	XMLName      xml.Name `xml:"wsse:BinarySecurityToken"`
+	ID           string   `xml:"wsu:Id,attr"`
+	ValueType    string   `xml:"ValueType,attr"`
+	EncodingType string   `xml:"EncodingType,attr"`
+	Value        string   `xml:",chardata"`
+}
+
+type wsuTimestamp struct {
+	XMLName xml.Name `xml:"wsu:Timestamp"`
+	ID      string   `xml:"wsu:Id,attr"`
+	Created string   `xml:"wsu:Created"`
+	Expires string   `xml:"wsu:Expires"`
+}
+
+type signature struct {
+	XMLName        xml.Name `xml:"ds:Signature"`
+	DsXmlns        string   `xml:"xmlns:ds,attr"`
+	SignedInfo     signedInfo
+	SignatureValue string `xml:"ds:SignatureValue"`
+	KeyInfo        keyInfo
+}
+
+type signedInfo struct {
+	XMLName                xml.Name      `xml:"ds:SignedInfo"`
+	CanonicalizationMethod algorithmRef  `xml:"ds:CanonicalizationMethod"`
+	SignatureMethod        algorithmRef  `xml:"ds:SignatureMethod"`
+	Reference              []dsReference `xml:"ds:Reference"`
+}
+
+type algorithmRef struct {
+	Algorithm string `xml:"Algorithm,attr"`
+}
+
+type dsReference struct {
+	URI          string         `xml:"URI,attr"`
+	Transforms   []algorithmRef `xml:"ds:Transforms>ds:Transform"`
+	DigestMethod algorithmRef   `xml:"ds:DigestMethod"`
+	DigestValue  string         `xml:"ds:DigestValue"`
+}
+
+type keyInfo struct {
+	XMLName                xml.Name `xml:"ds:KeyInfo"`
+	SecurityTokenReference securityTokenReference
+}
+
+type securityTokenReference struct {
+	XMLName   xml.Name     `xml:"wsse:SecurityTokenReference"`
+	Reference keyReference `xml:"wsse:Reference"`
+}
+
+type keyReference struct {
+	URI       string `xml:"URI,attr"`
+	ValueType string `xml:"ValueType,attr"`
+}
+
+/*
+DoSigned behaves like Do, but first builds a <wsse:Security> header carrying a
+BinarySecurityToken for auth's certificate and an XML signature (exclusive C14N +
+RSA-SHA1/RSA-SHA256) over the SOAP Body and a Timestamp, as required by servers
+doing WS-Security X.509 authentication.
+*/
+func (s *SOAPClient) DoSigned(auth *WSSEAuthInfo, soapAction string, request, response interface{}) error {
+	if auth == nil {
+		return fmt.Errorf("wsse: auth is required")
+	}
+
+	bodyID := "Body-1"
+	tsID := "Timestamp-1"
+	bstID := "X509-1"
+
+	bodyWrapper := struct {
+		XMLName  xml.Name
+		ID       string      `xml:"wsu:Id,attr"`
+		WsuXmlns string      `xml:"xmlns:wsu,attr"`
+		Content  interface{} `xml:",any"`
+	}{
+		XMLName:  xml.Name{Space: s.envelopeNS(), Local: "Body"},
+		ID:       bodyID,
+		WsuXmlns: wsuNS,
+		Content:  request,
+	}
+
+	bodyXML, err := xml.Marshal(bodyWrapper)
+	if err != nil {
+		return err
+	}
+	canonicalBody, err := canonicalizeExclusive(bodyXML)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	ts := wsuTimestamp{
+		ID:      tsID,
+		Created: now.Format("2006-01-02T15:04:05.000Z"),
+		Expires: now.Add(5 * time.Minute).Format("2006-01-02T15:04:05.000Z"),
+	}
+	tsXML, err := xml.Marshal(struct {
+		XMLName  xml.Name `xml:"wsu:Timestamp"`
+		WsuXmlns string   `xml:"xmlns:wsu,attr"`
+		wsuTimestamp
+	}{WsuXmlns: wsuNS, wsuTimestamp: ts})
+	if err != nil {
+		return err
+	}
+	canonicalTS, err := canonicalizeExclusive(tsXML)
+	if err != nil {
+		return err
+	}
+
+	digestBody, digestAlgo, sigAlgo, hashFn := auth.digest(canonicalBody)
+	digestTS, _, _, _ := auth.digest(canonicalTS)
+
+	si := signedInfo{
+		CanonicalizationMethod: algorithmRef{Algorithm: c14nAlgo},
+		SignatureMethod:        algorithmRef{Algorithm: sigAlgo},
+		Reference: []dsReference{
+			{
+				URI:          "#" + bodyID,
+				Transforms:   []algorithmRef{{Algorithm: c14nAlgo}},
+				DigestMethod: algorithmRef{Algorithm: digestAlgo},
+				DigestValue:  base64.StdEncoding.EncodeToString(digestBody),
+			},
+			{
+				URI:          "#" + tsID,
+				Transforms:   []algorithmRef{{Algorithm: c14nAlgo}},
+				DigestMethod: algorithmRef{Algorithm: digestAlgo},
+				DigestValue:  base64.StdEncoding.EncodeToString(digestTS),
+			},
+		},
+	}
+
+	siXML, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"ds:SignedInfo"`
+		DsXmlns string   `xml:"xmlns:ds,attr"`
+		signedInfo
+	}{DsXmlns: dsNS, signedInfo: si})
+	if err != nil {
+		return err
+	}
+	canonicalSI, err := canonicalizeExclusive(siXML)
+	if err != nil {
+		return err
+	}
+
+	sigValue, err := rsa.SignPKCS1v15(rand.Reader, auth.key, hashFn, sum(hashFn, canonicalSI))
+	if err != nil {
+		return fmt.Errorf("wsse: failed to sign SignedInfo: %w", err)
+	}
+
+	security := wsseSecurity{
+		WsseXmlns:      wsseNS,
+		WsuXmlns:       wsuNS,
+		MustUnderstand: "1",
+		BinarySecurityToken: binarySecurityToken{
+			ID:           bstID,
+			ValueType:    bstValueType,
+			EncodingType: bstEncodingType,
+			Value:        base64.StdEncoding.EncodeToString(auth.certDER),
+		},
+		Timestamp: ts,
+		Signature: signature{
+			DsXmlns:        dsNS,
+			SignedInfo:     si,
+			SignatureValue: base64.StdEncoding.EncodeToString(sigValue),
+			KeyInfo: keyInfo{
+				SecurityTokenReference: securityTokenReference{
+					Reference: keyReference{URI: "#" + bstID, ValueType: strValueType},
+				},
+			},
+		},
+	}
+
+	return s.doWithHeaderAndBody(soapAction, &security, bodyWrapper, response)
+}
+
+// doWithHeaderAndBody sends an envelope carrying a pre-built wsse:Security header
+// and an already wsu:Id-tagged body, then decodes the response the same way Do does.
+// The envelope and header are built under whichever SOAP version s is configured
+// for (see encodeEnvelope), so a signed request matches the Content-Type
+// attemptRequest picks for it.
+func (s *SOAPClient) doWithHeaderAndBody(soapAction string, securityHeader interface{}, body interface{}, response interface{}) error {
+	envNS := s.envelopeNS()
+
+	header := struct {
+		XMLName xml.Name
+		Header  interface{}
+	}{XMLName: xml.Name{Space: envNS, Local: "Header"}, Header: securityHeader}
+
+	envelope := struct {
+		XMLName  xml.Name
+		XSIXmlns string `xml:"xmlns:xsi,attr"`
+		Header   interface{}
+		Body     interface{}
+	}{
+		XMLName:  xml.Name{Space: envNS, Local: "Envelope"},
+		XSIXmlns: "http://www.w3.org/2001/XMLSchema-instance",
+		Header:   header,
+		Body:     body,
+	}
+
+	buffer := new(bytes.Buffer)
+	encoder := xml.NewEncoder(buffer)
+	if err := encoder.Encode(envelope); err != nil {
+		return err
+	}
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+
+	return s.doRawRequest(soapAction, buffer, response)
+}
+
+func (a *WSSEAuthInfo) digest(data []byte) (digest []byte, digestAlgo, sigAlgo string, hashFn crypto.Hash) {
+	if a.useSHA256 {
+		d := sha256.Sum256(data)
+		return d[:], "http://www.w3.org/2001/04/xmlenc#sha256", "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256", crypto.SHA256
+	}
+	d := sha1.Sum(data)
+	return d[:], "http://www.w3.org/2000/09/xmldsig#sha1", "http://www.w3.org/2000/09/xmldsig#rsa-sha1", crypto.SHA1
+}
+
+func sum(hashFn crypto.Hash, data []byte) []byte {
+	h := hashFn.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+/*
+canonicalizeExclusive performs a minimal exclusive XML canonicalization (c14n) pass
+over an XML fragment: elements are re-serialized with their attributes sorted
+alphabetically (namespace declarations first, by prefix, then the rest by qualified
+name), self-closing tags are expanded, and character data, whitespace included, is
+kept as it is (escaped with xml.EscapeText). Namespace prefixes are preserved: xml.Decoder resolves every prefixed name
+to its namespace URI as it walks the token stream, so canonicalization tracks a
+URI->prefix table seeded from the xmlns/xmlns:* attributes it observes (scoped like
+real XML namespace scoping, inherited by descendants and shadowed by redeclaration)
+and re-qualifies every element and attribute name from it. It does not implement the
+full exclusive-c14n specification (in particular rendering of inherited-but-unused
+namespace nodes or nested InclusiveNamespaces lists), but it is namespace-preserving,
+stable and repeatable for a given logical document, which is what's required to
+digest/sign it.
+*/
+func canonicalizeExclusive(fragment []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(fragment))
+	var out bytes.Buffer
+	var stack []nsScope
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("wsse: canonicalization failed: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			bindings := map[string]string{}
+			if len(stack) > 0 {
+				for uri, prefix := range stack[len(stack)-1].bindings {
+					bindings[uri] = prefix
+				}
+			}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					bindings[a.Value] = a.Name.Local
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					bindings[a.Value] = ""
+				}
+			}
+
+			scope := nsScope{bindings: bindings, qname: qualifyName(bindings, t.Name)}
+			stack = append(stack, scope)
+			writeCanonicalStart(&out, t, scope)
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("wsse: canonicalization failed: unbalanced end element %q", t.Name.Local)
+			}
+			scope := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			out.WriteString("</")
+			out.WriteString(scope.qname)
+			out.WriteString(">")
+		case xml.CharData:
+			xml.EscapeText(&out, t)
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// nsScope is the namespace-URI->prefix table in effect at a given element, plus
+// that element's own already-qualified name, tracked on a stack as the
+// canonicalizer walks into and back out of the document.
+type nsScope struct {
+	bindings map[string]string
+	qname    string
+}
+
+// qualifyName re-derives the prefix:local (or bare local, for the unprefixed/default
+// case) form of a decoder-resolved xml.Name using the namespace bindings in scope.
+func qualifyName(bindings map[string]string, name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	if prefix, ok := bindings[name.Space]; ok {
+		if prefix == "" {
+			return name.Local
+		}
+		return prefix + ":" + name.Local
+	}
+	// The namespace URI was never declared in anything we've walked through (not
+	// well-formed XML); fall back to the bare local name rather than failing.
+	return name.Local
+}
+
+func writeCanonicalStart(out *bytes.Buffer, t xml.StartElement, scope nsScope) {
+	out.WriteString("<")
+	out.WriteString(scope.qname)
+
+	type qualifiedAttr struct {
+		qname string
+		value string
+	}
+	attrs := make([]qualifiedAttr, 0, len(t.Attr))
+	for _, a := range t.Attr {
+		switch {
+		case a.Name.Space == "xmlns":
+			attrs = append(attrs, qualifiedAttr{"xmlns:" + a.Name.Local, a.Value})
+		case a.Name.Space == "" && a.Name.Local == "xmlns":
+			attrs = append(attrs, qualifiedAttr{"xmlns", a.Value})
+		default:
+			attrs = append(attrs, qualifiedAttr{qualifyName(scope.bindings, a.Name), a.Value})
+		}
+	}
+	isNSDecl := func(qname string) bool { return qname == "xmlns" || strings.HasPrefix(qname, "xmlns:") }
+	sort.Slice(attrs, func(i, j int) bool {
+		if di, dj := isNSDecl(attrs[i].qname), isNSDecl(attrs[j].qname); di != dj {
+			return di
+		}
+		return attrs[i].qname < attrs[j].qname
+	})
+
+	for _, a := range attrs {
+		out.WriteString(" ")
+		out.WriteString(a.qname)
+		out.WriteString(`="`)
+		xml.EscapeText(out, []byte(a.value))
+		out.WriteString(`"`)
+	}
+	out.WriteString(">")
+}
@@ -0,0 +1,68 @@
+package soapclient
+
+import "testing"
+
+// TestCanonicalizeExclusivePreservesNamespaces is a regression test for a bug
+// where canonicalizeExclusive dropped every namespace prefix/URI (localName only
+// ever read xml.Name.Local, never Name.Space), producing a digest/signature over
+// a de-namespaced fragment that no standards-compliant WS-Security verifier would
+// reproduce. It checks that prefixes declared on an ancestor element are still
+// resolved and re-emitted on descendants, that attribute namespaces round-trip,
+// and that the output is stable regardless of cosmetic differences (attribute
+// order, self-closing tags) in logically equivalent input.
+func TestCanonicalizeExclusivePreservesNamespaces(t *testing.T) {
+	tests := []struct {
+		name     string
+		fragment string
+		want     string
+	}{
+		{
+			name:     "prefixed element and attribute keep their namespace",
+			fragment: `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="#Body-1"><ds:DigestValue>abcd</ds:DigestValue></ds:Reference></ds:SignedInfo>`,
+			want:     `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Reference URI="#Body-1"><ds:DigestValue>abcd</ds:DigestValue></ds:Reference></ds:SignedInfo>`,
+		},
+		{
+			name:     "default namespace is inherited by unprefixed descendants",
+			fragment: `<Body xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:wsu="urn:wsu" wsu:Id="Body-1"><Echo>hi</Echo></Body>`,
+			want:     `<Body xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:wsu="urn:wsu" wsu:Id="Body-1"><Echo>hi</Echo></Body>`,
+		},
+		{
+			name:     "self-closing tags expand into a start and end tag pair",
+			fragment: `<ds:Transforms xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Transform Algorithm="urn:alg"/></ds:Transforms>`,
+			want:     `<ds:Transforms xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:Transform Algorithm="urn:alg"></ds:Transform></ds:Transforms>`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := canonicalizeExclusive([]byte(tc.fragment))
+			if err != nil {
+				t.Fatalf("canonicalizeExclusive: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Fatalf("canonicalizeExclusive(%s) = %s, want %s", tc.fragment, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestCanonicalizeExclusiveStableUnderReordering checks that two differently
+// formatted but logically equivalent fragments (attributes in a different order)
+// canonicalize to byte-identical output, which is
+// the property DoSigned's digest/signature relies on.
+func TestCanonicalizeExclusiveStableUnderReordering(t *testing.T) {
+	a := `<wsu:Timestamp xmlns:wsu="urn:wsu" wsu:Id="Timestamp-1"><wsu:Created>2024-01-01T00:00:00.000Z</wsu:Created><wsu:Expires>2024-01-01T00:05:00.000Z</wsu:Expires></wsu:Timestamp>`
+	b := `<wsu:Timestamp wsu:Id="Timestamp-1" xmlns:wsu="urn:wsu"><wsu:Created>2024-01-01T00:00:00.000Z</wsu:Created><wsu:Expires>2024-01-01T00:05:00.000Z</wsu:Expires></wsu:Timestamp>`
+
+	gotA, err := canonicalizeExclusive([]byte(a))
+	if err != nil {
+		t.Fatalf("canonicalizeExclusive(a): %v", err)
+	}
+	gotB, err := canonicalizeExclusive([]byte(b))
+	if err != nil {
+		t.Fatalf("canonicalizeExclusive(b): %v", err)
+	}
+	if string(gotA) != string(gotB) {
+		t.Fatalf("canonicalization not stable under reordering/whitespace:\na: %s\nb: %s", gotA, gotB)
+	}
+}
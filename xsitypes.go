@@ -0,0 +1,318 @@
+package soapclient
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/*
+RequireXSITypes toggles forcing an xsi:type attribute onto every scalar element of
+an outgoing request, using the default XSD type for its Go kind (string->xsd:string,
+int/int32/int64->xsd:int/xsd:long, float32/float64->xsd:double, bool->xsd:boolean,
+time.Time->xsd:dateTime), for servers that reject untyped elements. It returns the
+same SOAPClient for chaining.
+
+Individual fields can instead (or additionally) be tagged explicitly with
+`soap:"xsi:xsd:string"` (see xsiTypeFromTag); an explicit tag always wins over the
+toggle's default for that field.
+*/
+func (s *SOAPClient) RequireXSITypes(require bool) *SOAPClient {
+	s.requireXSI = require
+	return s
+}
+
+// xsiTypeFromTag extracts the xsi:type value from a `soap:"xsi:xsd:string"` struct
+// tag, e.g. "xsi:xsd:string" yields ("xsd:string", true).
+func xsiTypeFromTag(tag string) (string, bool) {
+	if !strings.HasPrefix(tag, "xsi:") {
+		return "", false
+	}
+	return strings.TrimPrefix(tag, "xsi:"), true
+}
+
+// defaultXSDType maps a Go value's kind to the xsd:type RequireXSITypes forces
+// when no explicit `soap:"xsi:..."` tag is present.
+func defaultXSDType(v reflect.Value) (string, bool) {
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		return "xsd:dateTime", true
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return "xsd:string", true
+	case reflect.Int, reflect.Int32:
+		return "xsd:int", true
+	case reflect.Int64:
+		return "xsd:long", true
+	case reflect.Float32, reflect.Float64:
+		return "xsd:double", true
+	case reflect.Bool:
+		return "xsd:boolean", true
+	}
+	return "", false
+}
+
+// hasXSITags reports whether v (or any of its nested fields) carries a
+// `soap:"xsi:..."` tag, in which case DoWithHeaders/Do must route it through the
+// xsiElement tree instead of the normal encoding/xml path even if RequireXSITypes
+// was never called.
+func hasXSITags(v reflect.Value) bool {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Name == "XMLName" {
+			continue
+		}
+		if _, ok := xsiTypeFromTag(f.Tag.Get("soap")); ok {
+			return true
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			for j := 0; j < fv.Len(); j++ {
+				if hasXSITags(fv.Index(j)) {
+					return true
+				}
+			}
+			continue
+		}
+
+		if hasXSITags(fv) {
+			return true
+		}
+	}
+	return false
+}
+
+// xsiElement is a reflection-built parallel tree of a request value, letting us
+// inject xsi:type attributes that encoding/xml's own Marshal has no hook for.
+type xsiElement struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	value    string
+	isStruct bool
+	children []xsiElement
+}
+
+/*
+MarshalXML lets xsiElement stand in for the original request value: it ignores
+the start element the encoder would have derived from its Go type and instead
+emits its own recorded name, attributes and content.
+*/
+func (e xsiElement) MarshalXML(enc *xml.Encoder, _ xml.StartElement) error {
+	start := xml.StartElement{Name: e.name, Attr: e.attrs}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	if e.value != "" {
+		if err := enc.EncodeToken(xml.CharData(e.value)); err != nil {
+			return err
+		}
+	}
+	for _, child := range e.children {
+		if err := enc.Encode(child); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// xmlFieldTag is a struct field's parsed `xml:"..."` tag: the element/attribute
+// name (with its optional namespace) plus the handful of encoding/xml options the
+// xsiElement tree building cares about. It mirrors encoding/xml's own tag syntax,
+// "[namespace ]name[,option]...", rather than using the raw tag verbatim, since
+// the raw string (e.g. "Name,omitempty") is not a valid element name on its own.
+type xmlFieldTag struct {
+	name      xml.Name
+	skip      bool
+	attr      bool
+	chardata  bool
+	any       bool
+	omitempty bool
+}
+
+// parseXMLFieldTag parses tag the way encoding/xml parses a field's xml tag,
+// falling back to fallback as the local name when the tag carries none.
+func parseXMLFieldTag(tag, fallback string) xmlFieldTag {
+	if tag == "-" {
+		return xmlFieldTag{skip: true}
+	}
+
+	parts := strings.Split(tag, ",")
+	var ft xmlFieldTag
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "attr":
+			ft.attr = true
+		case "chardata":
+			ft.chardata = true
+		case "any":
+			ft.any = true
+		case "omitempty":
+			ft.omitempty = true
+		}
+	}
+
+	switch fields := strings.Fields(parts[0]); len(fields) {
+	case 0:
+		ft.name = xml.Name{Local: fallback}
+	case 1:
+		ft.name = xml.Name{Local: fields[0]}
+	default:
+		ft.name = xml.Name{Space: fields[0], Local: fields[len(fields)-1]}
+	}
+	return ft
+}
+
+// isEmptyValue reports whether v is the zero value for its kind, for the same
+// omitempty check encoding/xml applies when marshalling.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// elementName resolves the xml.Name an xsiElement built from v should use,
+// preferring v's own XMLName tag (matching how encoding/xml names a struct
+// value nested under an xml:",any" field) and otherwise falling back to
+// fallback.
+func elementName(v reflect.Value, fallback xml.Name) xml.Name {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return fallback
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fallback
+	}
+	f, ok := v.Type().FieldByName("XMLName")
+	if !ok {
+		return fallback
+	}
+	tag := parseXMLFieldTag(f.Tag.Get("xml"), fallback.Local)
+	if tag.skip {
+		return fallback
+	}
+	return tag.name
+}
+
+// scalarString renders a non-struct, non-slice value the way buildXSIElement's
+// leaf case does, for use in both element text content and xsi:attr values.
+func scalarString(v reflect.Value) string {
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		return v.Interface().(time.Time).Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+// xsiElementForRequest builds the xsiElement tree for an outgoing request value,
+// rooted either at its XMLName tag (matching encoding/xml's own convention) or,
+// failing that, its Go type name.
+func xsiElementForRequest(request interface{}, force bool) xsiElement {
+	v := reflect.ValueOf(request)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	name := elementName(v, xml.Name{Local: v.Type().Name()})
+	return buildXSIElement(name, v, "", force)
+}
+
+func buildXSIElement(name xml.Name, v reflect.Value, soapTag string, force bool) xsiElement {
+	elem := xsiElement{name: name}
+
+	if xsdType, ok := xsiTypeFromTag(soapTag); ok {
+		elem.attrs = append(elem.attrs, xml.Attr{Name: xml.Name{Local: "xsi:type"}, Value: xsdType})
+	} else if force {
+		dv := v
+		for dv.Kind() == reflect.Ptr && !dv.IsNil() {
+			dv = dv.Elem()
+		}
+		if xsdType, ok := defaultXSDType(dv); ok {
+			elem.attrs = append(elem.attrs, xml.Attr{Name: xml.Name{Local: "xsi:type"}, Value: xsdType})
+		}
+	}
+
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return elem
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct && v.Type() != reflect.TypeOf(time.Time{}) {
+		elem.isStruct = true
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" || f.Name == "XMLName" {
+				continue
+			}
+
+			fv := v.Field(i)
+			tag := parseXMLFieldTag(f.Tag.Get("xml"), f.Name)
+			if tag.skip || (tag.omitempty && isEmptyValue(fv)) {
+				continue
+			}
+
+			if tag.chardata {
+				elem.value = scalarString(fv)
+				continue
+			}
+
+			if tag.attr {
+				elem.attrs = append(elem.attrs, xml.Attr{Name: tag.name, Value: scalarString(fv)})
+				continue
+			}
+
+			childName := tag.name
+			if tag.any {
+				childName = elementName(fv, tag.name)
+			}
+
+			if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+				for j := 0; j < fv.Len(); j++ {
+					elemChildName := childName
+					if tag.any {
+						elemChildName = elementName(fv.Index(j), tag.name)
+					}
+					elem.children = append(elem.children, buildXSIElement(elemChildName, fv.Index(j), f.Tag.Get("soap"), force))
+				}
+				continue
+			}
+
+			elem.children = append(elem.children, buildXSIElement(childName, fv, f.Tag.Get("soap"), force))
+		}
+		return elem
+	}
+
+	elem.value = scalarString(v)
+	return elem
+}
@@ -0,0 +1,130 @@
+package soapclient
+
+import (
+	"bytes"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestXsiElementForRequestStripsTagOptions is a regression test for a bug where
+// buildXSIElement used a struct field's raw `xml:"Name,omitempty"` tag verbatim
+// as the child element's name, producing a literal (and invalid) element name of
+// "Name,omitempty" instead of "Name". gowsdl-generated request structs (this
+// package's lineage) tag fields with `,omitempty` constantly, so this hit any
+// such request as soon as xsi:type injection kicked in.
+func TestXsiElementForRequestStripsTagOptions(t *testing.T) {
+	type Inner struct {
+		Name string `xml:"Name,omitempty"`
+	}
+
+	v := Inner{Name: "hi"}
+	got := xsiElementForRequest(&v, true)
+
+	if got.name.Local != "Inner" {
+		t.Fatalf("root name = %q, want %q", got.name.Local, "Inner")
+	}
+	if len(got.children) != 1 {
+		t.Fatalf("children = %d, want 1", len(got.children))
+	}
+	if got.children[0].name.Local != "Name" {
+		t.Fatalf("child name = %q, want %q (must strip the ,omitempty option)", got.children[0].name.Local, "Name")
+	}
+
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	if err := enc.Encode(got); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if want := `<Inner><Name xsi:type="xsd:string">hi</Name></Inner>`; buf.String() != want {
+		t.Fatalf("marshalled = %s, want %s", buf.String(), want)
+	}
+}
+
+// TestXsiElementForRequestOmitsEmptyField checks that a `,omitempty` field with
+// its Go zero value is dropped from the xsi tree entirely, matching
+// encoding/xml's own omitempty semantics, rather than appearing as an empty
+// element once the tag is parsed correctly.
+func TestXsiElementForRequestOmitsEmptyField(t *testing.T) {
+	type Inner struct {
+		Name string `xml:"Name,omitempty"`
+	}
+
+	got := xsiElementForRequest(&Inner{}, false)
+	if len(got.children) != 0 {
+		t.Fatalf("children = %d, want 0 (empty omitempty field should be dropped)", len(got.children))
+	}
+}
+
+// TestXsiElementForRequestPreservesNamespace is a regression test for a bug
+// where xsiElement only ever stored a bare local name, so xsiElementForRequest
+// discarded the namespace URI off an XMLName tag like
+// `xml:"http://some/ns RequestType"` - losing the outgoing envelope's namespace
+// declaration as soon as XSI typing kicked in.
+func TestXsiElementForRequestPreservesNamespace(t *testing.T) {
+	type Request struct {
+		XMLName xml.Name `xml:"http://example.com/ns EchoRequest"`
+		Msg     string
+	}
+
+	got := xsiElementForRequest(&Request{Msg: "hi"}, false)
+	if got.name != (xml.Name{Space: "http://example.com/ns", Local: "EchoRequest"}) {
+		t.Fatalf("root name = %#v, want namespace preserved", got.name)
+	}
+
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	if err := enc.Encode(got); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if want := `<EchoRequest xmlns="http://example.com/ns"><Msg>hi</Msg></EchoRequest>`; buf.String() != want {
+		t.Fatalf("marshalled = %s, want %s", buf.String(), want)
+	}
+}
+
+// TestHasXSITagsFindsTagInSliceElement is a regression test for a bug where
+// hasXSITags bailed out on any non-struct field kind, so a `soap:"xsi:..."` tag
+// on a slice-of-struct element's field (e.g. Items []Item where Item.Name
+// carries the tag) was never detected. Line items/lists are an extremely common
+// SOAP shape, so this silently dropped the caller's explicit xsi:type annotation
+// on a large share of real requests.
+func TestHasXSITagsFindsTagInSliceElement(t *testing.T) {
+	type Item struct {
+		Name string `soap:"xsi:xsd:string"`
+	}
+	type Request struct {
+		Items []Item
+	}
+
+	if !hasXSITags(reflect.ValueOf(Request{Items: []Item{{Name: "a"}}})) {
+		t.Fatal("hasXSITags = false, want true for a tag nested in a slice element")
+	}
+}
+
+// TestEncodeEnvelopeDeclaresXSINamespaceUnderSOAP12 is a regression test for a
+// bug where soap12Envelope had no xmlns:xsi field at all, so combining
+// WithVersion(SOAP12) with RequireXSITypes(true) (or any soap:"xsi:..." tag)
+// produced xsi:type attributes under a prefix that was never declared anywhere
+// in the document - invalid XML per the namespace spec.
+func TestEncodeEnvelopeDeclaresXSINamespaceUnderSOAP12(t *testing.T) {
+	type echoRequest struct {
+		Msg string
+	}
+
+	client := New("http://example.com/soap").WithVersion(SOAP12).RequireXSITypes(true)
+
+	buf, err := client.encodeEnvelope(nil, &echoRequest{Msg: "hi"})
+	if err != nil {
+		t.Fatalf("encodeEnvelope: %v", err)
+	}
+	if !strings.Contains(buf.String(), `xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"`) {
+		t.Fatalf("envelope missing xmlns:xsi declaration: %s", buf.String())
+	}
+}